@@ -0,0 +1,431 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveOpener turns the raw contents of an archive file into an fs.FS so
+// its entries can be walked like any other directory.
+type ArchiveOpener func(r io.ReaderAt, size int64) (fs.FS, error)
+
+var (
+	archiveMu      sync.RWMutex
+	archiveOpeners = map[string]ArchiveOpener{}
+)
+
+// RegisterArchiveFS teaches mgp how to descend into archive files with the
+// given extension (e.g. ".zip") when -archives is passed. ext is matched
+// case-sensitively against the end of the filename, so multi-part
+// extensions like ".tar.gz" are supported.
+func RegisterArchiveFS(ext string, opener ArchiveOpener) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	archiveOpeners[ext] = opener
+}
+
+func init() {
+	RegisterArchiveFS(".zip", openZipFS)
+	RegisterArchiveFS(".jar", openZipFS)
+	RegisterArchiveFS(".tar", openTarFS)
+	RegisterArchiveFS(".tar.gz", openTarGzFS)
+}
+
+// archiveExtOf reports the registered archive extension name is suffixed
+// with, if any.
+func archiveExtOf(name string) (string, bool) {
+	archiveMu.RLock()
+	defer archiveMu.RUnlock()
+
+	for ext := range archiveOpeners {
+		if strings.HasSuffix(name, ext) {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+func openArchiveOpener(ext string) (ArchiveOpener, bool) {
+	archiveMu.RLock()
+	defer archiveMu.RUnlock()
+	opener, ok := archiveOpeners[ext]
+	return opener, ok
+}
+
+func openZipFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	return zip.NewReader(r, size)
+}
+
+func openTarFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	return newTarFS(io.NewSectionReader(r, 0, size))
+}
+
+func openTarGzFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return newTarFS(gz)
+}
+
+// newTarFS reads every regular entry of a tar stream into memory and hands
+// it back as an fs.FS, since the tar format has no random access.
+func newTarFS(r io.Reader) (fs.FS, error) {
+	tr := tar.NewReader(r)
+	fsys := newMemFS()
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		fsys.add(hdr.Name, data, fs.FileMode(hdr.Mode).Perm(), hdr.ModTime)
+	}
+
+	return fsys, nil
+}
+
+// archiveFS wraps an fs.FS so that, when enabled, archive files are
+// presented as if they were directories: ReadDir on their parent reports
+// them with IsDir() true, and reading through them opens the archive and
+// descends into its entries.
+type archiveFS struct {
+	base    fs.FS
+	enabled bool
+}
+
+func newArchiveFS(base fs.FS, enabled bool) fs.FS {
+	return &archiveFS{base: base, enabled: enabled}
+}
+
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	if a.enabled {
+		if archBase, ext, rest, ok := splitArchivePath(name); ok {
+			sub, err := a.openArchive(archBase, ext)
+			if err != nil {
+				return nil, err
+			}
+			if rest == "" {
+				rest = "."
+			}
+			return sub.Open(rest)
+		}
+	}
+
+	return a.base.Open(name)
+}
+
+func (a *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if a.enabled {
+		if archBase, ext, rest, ok := splitArchivePath(name); ok {
+			sub, err := a.openArchive(archBase, ext)
+			if err != nil {
+				return nil, err
+			}
+			if rest == "" {
+				rest = "."
+			}
+			return fs.ReadDir(sub, rest)
+		}
+	}
+
+	entries, err := fs.ReadDir(a.base, name)
+	if err != nil || !a.enabled {
+		return entries, err
+	}
+
+	out := make([]fs.DirEntry, len(entries))
+	for i, e := range entries {
+		if !e.IsDir() {
+			if _, ok := archiveExtOf(e.Name()); ok {
+				e = archiveDirEntry{e}
+			}
+		}
+		out[i] = e
+	}
+	return out, nil
+}
+
+// openArchive reads archPath (a file in the base fs.FS) fully into memory
+// and opens it with the opener registered for ext.
+func (a *archiveFS) openArchive(archPath, ext string) (fs.FS, error) {
+	opener, ok := openArchiveOpener(ext)
+	if !ok {
+		return nil, fmt.Errorf("mgp: no archive opener registered for %q", ext)
+	}
+
+	f, err := a.base.Open(archPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return opener(bytes.NewReader(data), int64(len(data)))
+}
+
+// splitArchivePath finds the first path component (in order) that is
+// itself an archive file, and splits name into the path up to and
+// including it (archBase), its registered extension (ext) and whatever
+// comes after it (rest, empty if name names the archive itself).
+func splitArchivePath(name string) (archBase, ext, rest string, ok bool) {
+	if name == "." {
+		return "", "", "", false
+	}
+
+	parts := strings.Split(name, "/")
+	acc := ""
+
+	for i, p := range parts {
+		if acc == "" {
+			acc = p
+		} else {
+			acc = acc + "/" + p
+		}
+
+		if e, archOk := archiveExtOf(p); archOk {
+			return acc, e, strings.Join(parts[i+1:], "/"), true
+		}
+	}
+
+	return "", "", "", false
+}
+
+type archiveDirEntry struct {
+	fs.DirEntry
+}
+
+func (archiveDirEntry) IsDir() bool { return true }
+
+func (e archiveDirEntry) Type() fs.FileMode {
+	return fs.ModeDir | e.DirEntry.Type().Perm()
+}
+
+func (e archiveDirEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return archiveFileInfo{info}, nil
+}
+
+type archiveFileInfo struct {
+	fs.FileInfo
+}
+
+func (archiveFileInfo) IsDir() bool { return true }
+
+func (fi archiveFileInfo) Mode() fs.FileMode {
+	return fs.ModeDir | fi.FileInfo.Mode().Perm()
+}
+
+// displayPath turns an fs.FS-relative path back into one a user would
+// recognize: joined under startpath, with the boundary into an archive
+// marked with "!" instead of "/" (archive.zip!inner/file.go).
+func displayPath(startpath, relpath string) string {
+	full := startpath
+	if relpath != "." {
+		full = filepath.Join(startpath, relpath)
+	}
+
+	parts := strings.Split(filepath.ToSlash(full), "/")
+	for i, p := range parts[:len(parts)-1] {
+		if _, ok := archiveExtOf(p); ok {
+			return strings.Join(parts[:i+1], "/") + "!" + strings.Join(parts[i+1:], "/")
+		}
+	}
+
+	return full
+}
+
+// memFS is a small purpose-built in-memory fs.FS used to present a
+// decompressed tar stream as walkable entries. Earlier this reached into
+// testing/fstest, which is test scaffolding rather than a production
+// dependency and offers no guarantee across Go versions; memFS keeps the
+// archive read path free of that.
+type memFS struct {
+	root *memNode
+}
+
+type memNode struct {
+	name    string
+	dir     bool
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+	entries map[string]*memNode
+}
+
+func newMemFS() *memFS {
+	return &memFS{root: &memNode{name: ".", dir: true, mode: fs.ModeDir | 0o555, entries: map[string]*memNode{}}}
+}
+
+// add registers a regular file at name, creating any implied parent
+// directories along the way.
+func (m *memFS) add(name string, data []byte, mode fs.FileMode, modTime time.Time) {
+	parts := strings.Split(path.Clean(name), "/")
+
+	dir := m.root
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := dir.entries[part]
+		if !ok {
+			next = &memNode{name: part, dir: true, mode: fs.ModeDir | 0o555, entries: map[string]*memNode{}}
+			dir.entries[part] = next
+		}
+		dir = next
+	}
+
+	base := parts[len(parts)-1]
+	dir.entries[base] = &memNode{name: base, mode: mode, modTime: modTime, data: data}
+}
+
+func (m *memFS) lookup(name string) (*memNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+
+	node := m.root
+	if name == "." {
+		return node, nil
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if !node.dir {
+			return nil, fs.ErrNotExist
+		}
+		next, ok := node.entries[part]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		node = next
+	}
+
+	return node, nil
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	node, err := m.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if node.dir {
+		return &memDir{node: node}, nil
+	}
+	return &memFileHandle{node: node, r: bytes.NewReader(node.data)}, nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := m.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !node.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return node.sortedEntries(), nil
+}
+
+func (n *memNode) info() fs.FileInfo { return memFileInfo{n} }
+
+func (n *memNode) sortedEntries() []fs.DirEntry {
+	names := make([]string, 0, len(n.entries))
+	for name := range n.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]fs.DirEntry, len(names))
+	for i, name := range names {
+		out[i] = fs.FileInfoToDirEntry(n.entries[name].info())
+	}
+	return out
+}
+
+type memFileInfo struct{ n *memNode }
+
+func (i memFileInfo) Name() string { return i.n.name }
+func (i memFileInfo) Size() int64  { return int64(len(i.n.data)) }
+func (i memFileInfo) Mode() fs.FileMode {
+	if i.n.dir {
+		return i.n.mode | fs.ModeDir
+	}
+	return i.n.mode
+}
+func (i memFileInfo) ModTime() time.Time { return i.n.modTime }
+func (i memFileInfo) IsDir() bool        { return i.n.dir }
+func (i memFileInfo) Sys() any           { return nil }
+
+type memFileHandle struct {
+	node *memNode
+	r    *bytes.Reader
+}
+
+func (h *memFileHandle) Stat() (fs.FileInfo, error) { return h.node.info(), nil }
+func (h *memFileHandle) Read(p []byte) (int, error) { return h.r.Read(p) }
+func (h *memFileHandle) Close() error               { return nil }
+
+type memDir struct {
+	node    *memNode
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.node.info(), nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: fmt.Errorf("is a directory")}
+}
+
+func (d *memDir) Close() error { return nil }
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = d.node.sortedEntries()
+	}
+
+	if n <= 0 {
+		out := d.entries[d.offset:]
+		d.offset = len(d.entries)
+		return out, nil
+	}
+
+	if d.offset >= len(d.entries) {
+		return nil, io.EOF
+	}
+
+	end := d.offset + n
+	if end > len(d.entries) {
+		end = len(d.entries)
+	}
+	out := d.entries[d.offset:end]
+	d.offset = end
+	return out, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func buildTarBytes(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0o644,
+			Size: int64(len(body)),
+		}); err != nil {
+			t.Fatalf("WriteHeader(%q): %v", name, err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatalf("Write(%q): %v", name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestNewTarFSBuildsNestedTree(t *testing.T) {
+	data := buildTarBytes(t, map[string]string{
+		"a.txt":         "top level",
+		"sub/b.txt":     "nested",
+		"sub/deep/c.go": "deeply nested",
+	})
+
+	fsys, err := newTarFS(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("newTarFS: %v", err)
+	}
+
+	got, err := fs.ReadFile(fsys, "sub/deep/c.go")
+	if err != nil {
+		t.Fatalf("ReadFile(sub/deep/c.go): %v", err)
+	}
+	if string(got) != "deeply nested" {
+		t.Fatalf("ReadFile(sub/deep/c.go) = %q, want %q", got, "deeply nested")
+	}
+
+	entries, err := fs.ReadDir(fsys, "sub")
+	if err != nil {
+		t.Fatalf("ReadDir(sub): %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	want := []string{"b.txt", "deep"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Fatalf("ReadDir(sub) names = %v, want %v", names, want)
+	}
+
+	var walked []string
+	if err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			walked = append(walked, p)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+	sort.Strings(walked)
+	wantWalked := []string{"a.txt", "sub/b.txt", "sub/deep/c.go"}
+	if len(walked) != len(wantWalked) {
+		t.Fatalf("WalkDir visited %v, want %v", walked, wantWalked)
+	}
+	for i := range wantWalked {
+		if walked[i] != wantWalked[i] {
+			t.Fatalf("WalkDir visited %v, want %v", walked, wantWalked)
+		}
+	}
+}
+
+func TestArchiveFSReadsZipEntriesAsDirectory(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("inner/hello.txt")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := w.Write([]byte("hello from zip")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	base := fstest.MapFS{
+		"archive.zip": &fstest.MapFile{Data: buf.Bytes()},
+	}
+
+	afs := newArchiveFS(base, true)
+
+	// fs.FS paths use a plain "/" through the archive boundary; the "!"
+	// marker is only used by displayPath for human-facing output.
+	data, err := fs.ReadFile(afs, "archive.zip/inner/hello.txt")
+	if err != nil {
+		t.Fatalf("ReadFile(archive.zip/inner/hello.txt): %v", err)
+	}
+	if string(data) != "hello from zip" {
+		t.Fatalf("ReadFile(archive.zip/inner/hello.txt) = %q, want %q", data, "hello from zip")
+	}
+
+	entries, err := fs.ReadDir(afs, ".")
+	if err != nil {
+		t.Fatalf("ReadDir(.): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "archive.zip" || !entries[0].IsDir() {
+		t.Fatalf("ReadDir(.) = %+v, want a single directory entry named archive.zip", entries)
+	}
+}
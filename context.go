@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type numberedLine struct {
+	n    int
+	text string
+}
+
+// ringBuffer keeps the last size lines seen, for -B/-C leading context.
+type ringBuffer struct {
+	lines []numberedLine
+	size  int
+	next  int
+	full  bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	if size <= 0 {
+		return &ringBuffer{}
+	}
+	return &ringBuffer{lines: make([]numberedLine, size), size: size}
+}
+
+func (b *ringBuffer) push(n int, text string) {
+	if b.size == 0 {
+		return
+	}
+	b.lines[b.next] = numberedLine{n, text}
+	b.next = (b.next + 1) % b.size
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// ordered returns the buffered lines oldest-first.
+func (b *ringBuffer) ordered() []numberedLine {
+	if b.size == 0 {
+		return nil
+	}
+	if !b.full {
+		return b.lines[:b.next]
+	}
+	out := make([]numberedLine, 0, b.size)
+	out = append(out, b.lines[b.next:]...)
+	out = append(out, b.lines[:b.next]...)
+	return out
+}
+
+func linesOf(nls []numberedLine) []string {
+	if len(nls) == 0 {
+		return nil
+	}
+	out := make([]string, len(nls))
+	for i, nl := range nls {
+		out[i] = nl.text
+	}
+	return out
+}
+
+// scanContext scans every line of e looking for matches of r, returning one
+// Match per matching line, each carrying up to `before`/`after` lines of
+// surrounding context. Presentation (highlighting, "path:line:" framing) is
+// left to the Reporter the Match is eventually handed to.
+func scanContext(e *Entry, displayName string, r *regexp.Regexp, before, after int, cf *ContentFilter) ([]Match, error) {
+	data, ok, err := readEntryData(e, cf)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	var matches []Match
+	leading := newRingBuffer(before)
+	pendingAfter := 0
+
+	// Read with an unbounded bufio.Reader rather than bufio.Scanner, which
+	// carries a fixed ~64KB per-line token limit: a single very long line
+	// (minified JS/CSS, a one-line JSON/SQL dump) would otherwise abort the
+	// whole scan, unlike the non-ctx path in mgp.go's handler.
+	reader := bufio.NewReader(bytes.NewReader(data))
+	lineno := 0
+
+	for {
+		raw, readErr := reader.ReadBytes('\n')
+		if len(raw) > 0 {
+			lineno++
+			line := strings.TrimSuffix(strings.TrimSuffix(string(raw), "\n"), "\r")
+
+			if loc := r.FindStringIndex(line); loc != nil {
+				matches = append(matches, Match{
+					Path:   displayName,
+					Line:   lineno,
+					Column: loc[0] + 1,
+					Match:  line,
+					Before: linesOf(leading.ordered()),
+				})
+				pendingAfter = after
+			} else if pendingAfter > 0 && len(matches) > 0 {
+				last := &matches[len(matches)-1]
+				last.After = append(last.After, line)
+				pendingAfter--
+			}
+
+			leading.push(lineno, line)
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Number of bytes peeked from the start of a file to decide whether it
+// looks binary, mirroring what ripgrep does.
+const binaryPeekBytes = 8192
+
+// isBinary reports whether data looks like a binary file: it contains a
+// NUL byte, or isn't valid UTF-8, within the first binaryPeekBytes.
+func isBinary(data []byte) bool {
+	peek := data
+	if len(peek) > binaryPeekBytes {
+		peek = peek[:binaryPeekBytes]
+		// Drop a multi-byte rune cut in half by the peek boundary, so it
+		// doesn't count as invalid UTF-8.
+		for i := 1; i < utf8.UTFMax && i <= len(peek); i++ {
+			if utf8.RuneStart(peek[len(peek)-i]) {
+				if !utf8.FullRune(peek[len(peek)-i:]) {
+					peek = peek[:len(peek)-i]
+				}
+				break
+			}
+		}
+	}
+
+	if bytes.IndexByte(peek, 0) != -1 {
+		return true
+	}
+
+	return !utf8.Valid(peek)
+}
+
+var (
+	fileTypesMu sync.RWMutex
+	fileTypes   = map[string][]string{
+		"go":   {".go"},
+		"py":   {".py"},
+		"js":   {".js", ".mjs", ".cjs"},
+		"ts":   {".ts", ".tsx"},
+		"java": {".java"},
+		"c":    {".c", ".h"},
+		"cpp":  {".cpp", ".cc", ".cxx", ".hpp", ".hxx"},
+		"rs":   {".rs"},
+		"rb":   {".rb"},
+		"php":  {".php"},
+		"sh":   {".sh", ".bash"},
+		"md":   {".md", ".markdown"},
+		"json": {".json"},
+		"yaml": {".yaml", ".yml"},
+		"toml": {".toml"},
+		"html": {".html", ".htm"},
+		"css":  {".css", ".scss", ".sass"},
+		"sql":  {".sql"},
+	}
+)
+
+// RegisterFileType teaches -type/-type-not about a new file type, so
+// downstream users can extend mgp's built-in type map with custom
+// languages or file conventions.
+func RegisterFileType(name string, extensions []string) {
+	fileTypesMu.Lock()
+	defer fileTypesMu.Unlock()
+	fileTypes[name] = extensions
+}
+
+func hasType(pathname string, names []string) bool {
+	ext := strings.ToLower(filepath.Ext(pathname))
+
+	fileTypesMu.RLock()
+	defer fileTypesMu.RUnlock()
+
+	for _, name := range names {
+		for _, e := range fileTypes[name] {
+			if e == ext {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeFilter implements -type/-type-not: a file must match one of include
+// (if given) and none of exclude.
+type typeFilter struct {
+	include []string
+	exclude []string
+}
+
+func newTypeFilter(include, exclude string) *typeFilter {
+	tf := &typeFilter{include: splitNonEmpty(include), exclude: splitNonEmpty(exclude)}
+	if len(tf.include) == 0 && len(tf.exclude) == 0 {
+		return nil
+	}
+	return tf
+}
+
+func (tf *typeFilter) Accept(pathname string) bool {
+	if len(tf.exclude) > 0 && hasType(pathname, tf.exclude) {
+		return false
+	}
+	if len(tf.include) > 0 && !hasType(pathname, tf.include) {
+		return false
+	}
+	return true
+}
+
+func splitNonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// parseSize parses a size such as "512", "64k", "10m" or "1g" into a byte
+// count. An empty string means "no limit" (0).
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	mult := int64(1)
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		mult = 1 << 10
+		s = s[:len(s)-1]
+	case 'm', 'M':
+		mult = 1 << 20
+		s = s[:len(s)-1]
+	case 'g', 'G':
+		mult = 1 << 30
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("mgp: invalid size %q", s)
+	}
+
+	return n * mult, nil
+}
+
+// ContentFilter decides, beyond PathSpec exclusion, whether a regular file
+// is worth scanning: its size range, -type/-type-not, and whether it looks
+// binary.
+type ContentFilter struct {
+	MinSize     int64
+	MaxSize     int64
+	AllowBinary bool
+	types       *typeFilter
+}
+
+func NewContentFilter(minSize, maxSize int64, allowBinary bool, typeList, typeNotList string) *ContentFilter {
+	return &ContentFilter{
+		MinSize:     minSize,
+		MaxSize:     maxSize,
+		AllowBinary: allowBinary,
+		types:       newTypeFilter(typeList, typeNotList),
+	}
+}
+
+// AcceptPath applies the size and -type/-type-not checks during the walk,
+// before a file is even opened.
+func (cf *ContentFilter) AcceptPath(pathname string, size int64) bool {
+	if size < cf.MinSize {
+		return false
+	}
+	if cf.MaxSize > 0 && size > cf.MaxSize {
+		return false
+	}
+	if cf.types != nil && !cf.types.Accept(pathname) {
+		return false
+	}
+	return true
+}
+
+// AcceptContent applies binary detection, which can only be decided once a
+// file has actually been read.
+func (cf *ContentFilter) AcceptContent(data []byte) bool {
+	return cf.AllowBinary || !isBinary(data)
+}
@@ -2,34 +2,29 @@ package main
 
 import (
 	"bufio"
-	"errors"
+	"bytes"
+	"context"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"regexp"
-	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/fatih/color"
+
+	"github.com/canta2899/multigrep/pipe"
 )
 
 type Entry struct {
 	Path string
 	Info *os.FileInfo
+	FS   fs.FS
 }
 
-type MessageType int64
-
-const (
-	MatchMessage MessageType = iota
-	ErrorMatchMessage
-	TextMessage
-)
-
-var coloredOutput bool = true
-
 // Runes for emoji
 const OK string = string('\u2713')
 const KO string = string('\u00D7')
@@ -38,189 +33,170 @@ const KO string = string('\u00D7')
 var green = color.New(color.FgHiGreen).SprintFunc()
 var red = color.New(color.FgRed).SprintFunc()
 
-func printHandler(message string, messageType MessageType) {
-	switch messageType {
-	case MatchMessage:
-		if coloredOutput {
-			log.Printf("%v %v\n", green(OK), message)
-		} else {
-			log.Printf("%v\n", message)
-		}
-		return
-	case ErrorMatchMessage:
-		if coloredOutput {
-			log.Printf("%v %v\n", red(KO), message)
-		}
-		return
+// Reads the contents of a regular entry, reporting ok=false for anything
+// that should be silently skipped (not a regular file, unreadable, or
+// filtered out by cf, e.g. binary detection).
+func readEntryData(e *Entry, cf *ContentFilter) (data []byte, ok bool, err error) {
+	if !(*e.Info).Mode().IsRegular() {
+		return nil, false, nil // Skips
 	}
 
-	log.Println(message)
-}
-
-// Routine performed by each worker
-func handler(ch <-chan *Entry, closech <-chan bool, wg *sync.WaitGroup, r *regexp.Regexp) {
-	defer wg.Done()
-
-	for {
-
-		select {
-		case <-closech:
-			return
-		case e, more := <-ch:
-			if !more {
-				return
-			}
-
-			info, fullpath := e.Info, e.Path
+	data, err = fs.ReadFile(e.FS, e.Path)
+	if err != nil {
+		return nil, false, nil // Skips
+	}
 
-			if !(*info).Mode().IsRegular() {
-				continue // Skips
-			}
+	if !cf.AcceptContent(data) {
+		return nil, false, nil // Skips
+	}
 
-			file, err := os.Open(fullpath)
+	return data, true, nil
+}
 
-			if err != nil {
-				continue // Skips
-			}
+// Scans a single entry for the given pattern, returning whether it matched.
+func handler(e *Entry, r *regexp.Regexp, cf *ContentFilter) (bool, error) {
+	data, ok, err := readEntryData(e, cf)
+	if err != nil || !ok {
+		return false, err
+	}
 
-			bufread := bufio.NewReader(file)
+	bufread := bufio.NewReader(bytes.NewReader(data))
 
-			for {
-				line, err := bufread.ReadBytes('\n')
+	for {
+		line, err := bufread.ReadBytes('\n')
 
-				if err == io.EOF {
-					break
-				}
+		// A last line without a trailing newline comes back together with
+		// io.EOF, so it is matched before the EOF check.
+		if len(line) > 0 && r.Match(line) {
+			return true, nil
+		}
 
-				if r.Match(line) {
-					printHandler(fullpath, MatchMessage)
-					break
-				}
-			}
-			file.Close()
-		default:
-			continue
+		if err == io.EOF {
+			break
 		}
 	}
+
+	return false, nil
 }
 
-// Process path and enqueues if ok for match checking
-func processPath(info *os.FileInfo, pathname string, c chan *Entry, exc []string, limitMb int) error {
-	isdir := (*info).IsDir()
+// Evaluates error for path and returns action to perform
+func handlePathError(reporter Reporter, isDir bool, pathname string, err error) error {
 
-	for _, n := range exc {
-		fullMatch, _ := filepath.Match(n, pathname)
-		baseMatch, _ := filepath.Match(n, filepath.Base(pathname))
-		if isdir && (fullMatch || baseMatch) {
-			return filepath.SkipDir
-		}
+	if os.IsNotExist(err) {
+		log.Fatal("Invalid path")
 	}
 
-	if !isdir && (*info).Size() < int64(limitMb) {
-		c <- &Entry{Path: pathname, Info: info}
+	reporter.ReportError(pathname, err)
+
+	if isDir {
+		return fs.SkipDir
 	}
 
 	return nil
 }
 
-// Evaluates error for path and returns action to perform
-func handlePathError(info *os.FileInfo, pathname string, err error) error {
-
-	if os.IsNotExist(err) {
-		log.Fatal("Invalid path")
+// Process path and reports whether it's worth enqueueing for match checking
+func processPath(isDir bool, pathname string, info fs.FileInfo, ps *PathSpec, cf *ContentFilter) (bool, error) {
+	if ps.Match(pathname, isDir) {
+		if isDir {
+			return false, fs.SkipDir
+		}
+		return false, nil
 	}
 
-	// Prints error line for current path
-	printHandler(pathname, ErrorMatchMessage)
-	printHandler(err.Error(), TextMessage)
+	if isDir {
+		return false, nil
+	}
 
-	if (*info).IsDir() {
-		return filepath.SkipDir
-	} else {
-		return nil
+	if !cf.AcceptPath(pathname, info.Size()) {
+		return false, nil
 	}
+
+	return true, nil
 }
 
-// Handler for sigterm (ctrl + c from cli)
-func setSignalHandlers(closed chan bool, workers int, stopWalk *bool, wg *sync.WaitGroup) {
-	sigch := make(chan os.Signal, 1)
-	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigch
+func Run(workers int, startpath string, r *regexp.Regexp,
+	ps *PathSpec, cf *ContentFilter, archives bool,
+	matchContext bool, before int, after int,
+	reporter Reporter) {
 
-		*stopWalk = true
+	// Cancellation is driven by ctrl+c instead of a shared stopWalk bool
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-		for i := 0; i < workers; i++ {
-			closed <- true
-		}
+	fsys := newArchiveFS(os.DirFS(startpath), archives)
 
-	}()
-}
+	start := time.Now()
+	var filesScanned, filesMatched, bytesScanned, errCount int64
 
-func Run(out io.Writer, workers int,
-	caseInsensitive bool, colors bool,
-	startpath string, pattern string,
-	exludedDirs []string, limitMb int) {
+	selectFn := func(relpath string, d fs.DirEntry, walkErr error) (bool, fs.FileInfo, error) {
+		fullpath := displayPath(startpath, relpath)
 
-	// Configuring logger
-	log.SetFlags(0)
-	log.SetOutput(out)
+		if walkErr != nil {
+			atomic.AddInt64(&errCount, 1)
+			return false, nil, handlePathError(reporter, d != nil && d.IsDir(), fullpath, walkErr)
+		}
 
-	// Output with symbols and colors
-	coloredOutput = colors
+		// Stat once here and thread the result straight through to the Job:
+		// re-stat'ing later would reopen a TOCTOU window where the file
+		// could vanish between the two calls.
+		info, err := d.Info()
+		if err != nil {
+			atomic.AddInt64(&errCount, 1)
+			reporter.ReportError(fullpath, err)
+			return false, nil, nil // Skips
+		}
 
-	// Regex compilation
-	if caseInsensitive {
-		pattern = "(?i)" + pattern
-	}
-	r, _ := regexp.Compile(pattern)
-
-	// Tools for synchronization
-	var wg sync.WaitGroup
-	stopWalk := false
-	closeSignalChan := make(chan bool, workers)
-	ch := make(chan *Entry, 5000)
-	setSignalHandlers(closeSignalChan, workers, &stopWalk, &wg)
-
-	// Spawning routines
-	wg.Add(workers)
-	for i := 0; i < workers; i++ {
-		go handler(ch, closeSignalChan, &wg, r)
+		ok, err := processPath(d.IsDir(), fullpath, info, ps, cf)
+		return ok, info, err
 	}
 
-	// Traversing filepath
-	filepath.Walk(startpath,
+	jobFn := func(job pipe.Job) pipe.Result {
+		fullpath := displayPath(startpath, job.Path)
+		entry := &Entry{Path: job.Path, Info: &job.Info, FS: job.FS}
 
-		func(pathname string, info os.FileInfo, err error) error {
+		atomic.AddInt64(&filesScanned, 1)
+		atomic.AddInt64(&bytesScanned, job.Info.Size())
 
-			if stopWalk {
-				// If the termination is requested, the path Walking
-				// stops and the function returns with an error
-				return errors.New("user requested termination")
-			}
-
-			// Checking permission and access errors
+		if matchContext {
+			matches, err := scanContext(entry, fullpath, r, before, after, cf)
 			if err != nil {
-				return handlePathError(&info, pathname, err)
+				atomic.AddInt64(&errCount, 1)
+				reporter.ReportError(fullpath, err)
+				return pipe.Result{Path: fullpath, Err: err}
 			}
+			if len(matches) > 0 {
+				atomic.AddInt64(&filesMatched, 1)
+				reporter.ReportMatches(matches)
+			}
+			return pipe.Result{Path: fullpath}
+		}
 
-			// Processes path in search of matches with the given
-			// pattern or the excluded directories
-			return processPath(&info, pathname, ch, exludedDirs, limitMb)
-
-		})
-
-	// The channel is closed, this communicates that
-	// no more values will be enqueued
-	close(ch)
+		matched, err := handler(entry, r, cf)
+		if err != nil {
+			atomic.AddInt64(&errCount, 1)
+			reporter.ReportError(fullpath, err)
+			return pipe.Result{Path: fullpath, Err: err}
+		}
 
-	// Waits for goroutines to finish
-	wg.Wait()
+		if matched {
+			atomic.AddInt64(&filesMatched, 1)
+			reporter.ReportMatch(Match{Path: fullpath})
+		}
 
-	// Ensures signal chan
-	close(closeSignalChan)
+		return pipe.Result{Path: fullpath}
+	}
 
-	if stopWalk {
-		printHandler("Ended by user", TextMessage)
+	// Draining the results also blocks Run until the walk and every
+	// in-flight job have completed.
+	for range pipe.Walk(ctx, fsys, workers, selectFn, jobFn) {
 	}
+
+	reporter.ReportSummary(Summary{
+		FilesScanned: atomic.LoadInt64(&filesScanned),
+		FilesMatched: atomic.LoadInt64(&filesMatched),
+		BytesScanned: atomic.LoadInt64(&bytesScanned),
+		ElapsedMs:    time.Since(start).Milliseconds(),
+		Errors:       atomic.LoadInt64(&errCount),
+	})
 }
@@ -2,13 +2,15 @@ package main
 
 import (
   "flag"
+  "fmt"
+  "io"
   "log"
   "os"
+  "regexp"
   "strings"
 )
 
 const VERSION string = "v1.4.1"
-const MEGABYTE int = 1048576
 const PROG_NAME = "mgp"
 
 var STD_EXC_DIRS = []string{".bzr", "CVS", ".git", ".hg", ".svn", ".idea", ".tox"}
@@ -18,16 +20,103 @@ type Flags struct {
   nocolor      bool
   icase        bool
   exclude      string
-  limitBytes   int
+  excludeFiles string
+  useGitignore bool
   matchContext bool
+  archives     bool
+  afterLines   int
+  beforeLines  int
+  ctxLines     int
+  format       string
+  minSize      string
+  maxSize      string
+  typeList     string
+  typeNotList  string
+  allowBinary  bool
 }
 
-func (f *Flags) GetExcludedDirs() []string {
-  if f.exclude == "" {
-    return STD_EXC_DIRS
+// BuildContentFilter assembles the ContentFilter consulted by processPath
+// and the scanners out of -min-size/-max-size, -type/-type-not and -a.
+func (f *Flags) BuildContentFilter() (*ContentFilter, error) {
+  minSize, err := parseSize(f.minSize)
+  if err != nil {
+    return nil, err
   }
 
-  return append(STD_EXC_DIRS, strings.Split(f.exclude, ",")...)
+  maxSize, err := parseSize(f.maxSize)
+  if err != nil {
+    return nil, err
+  }
+
+  return NewContentFilter(minSize, maxSize, f.allowBinary, f.typeList, f.typeNotList), nil
+}
+
+// ContextLines resolves the effective number of leading/trailing context
+// lines to print around a match, applying -C as a shorthand for "-A N -B N"
+// whenever -A/-B weren't set individually.
+func (f *Flags) ContextLines() (before, after int) {
+  before, after = f.beforeLines, f.afterLines
+  if f.ctxLines > 0 {
+    if before == 0 {
+      before = f.ctxLines
+    }
+    if after == 0 {
+      after = f.ctxLines
+    }
+  }
+  return
+}
+
+// BuildReporter picks the Reporter matching -format, handing the compiled
+// pattern to the text reporter for highlighting (it must be the very same
+// pattern Run ends up searching with).
+func (f *Flags) BuildReporter(out io.Writer, pattern *regexp.Regexp) (Reporter, error) {
+  switch f.format {
+  case "", "text":
+    return NewTextReporter(out, pattern, !f.nocolor), nil
+  case "json":
+    return NewJSONReporter(out), nil
+  case "ndjson":
+    return NewNDJSONReporter(out), nil
+  default:
+    return nil, fmt.Errorf("mgp: unknown -format %q, want text, json or ndjson", f.format)
+  }
+}
+
+// BuildPathSpec assembles the PathSpec consulted by processPath. If -git
+// was passed, every .gitignore found walking up from startpath is loaded
+// first; the standard excluded directories and the inline -exc patterns,
+// then any -exc-file gitignore-format files, are appended after, so that rules the
+// user asked for on the command line always take precedence over whatever
+// a project's own .gitignore happens to say.
+func (f *Flags) BuildPathSpec(startpath string) (*PathSpec, error) {
+  ps := &PathSpec{}
+
+  if f.useGitignore {
+    git, err := collectGitignores(startpath)
+    if err != nil {
+      return nil, err
+    }
+    ps.rules = append(ps.rules, git.rules...)
+  }
+
+  inline := append([]string{}, STD_EXC_DIRS...)
+  if f.exclude != "" {
+    inline = append(inline, strings.Split(f.exclude, ",")...)
+  }
+
+  var files []string
+  if f.excludeFiles != "" {
+    files = strings.Split(f.excludeFiles, ",")
+  }
+
+  user, err := NewPathSpec(startpath, inline, files)
+  if err != nil {
+    return nil, err
+  }
+  ps.rules = append(ps.rules, user.rules...)
+
+  return ps, nil
 }
 
 type Parameters struct {
@@ -54,13 +143,23 @@ func ParseArgs() *Parameters {
 
   flag.IntVar(&f.workers, "w", 100, "Defines the max number of routines running at the same time")
   flag.BoolVar(&printVersion, "v", false, "Prints current mgp version")
-  flag.IntVar(&f.limitBytes, "lim", 100, "File size limit")
+  flag.StringVar(&f.minSize, "min-size", "", "Skip files smaller than this size (accepts k, m, g suffixes)")
+  flag.StringVar(&f.maxSize, "max-size", "100m", "Skip files larger than this size (accepts k, m, g suffixes)")
+  flag.StringVar(&f.typeList, "type", "", "Only search files of these types, e.g. \"go,py\"")
+  flag.StringVar(&f.typeNotList, "type-not", "", "Skip files of these types, e.g. \"md,json\"")
+  flag.BoolVar(&f.allowBinary, "a", false, "Don't skip binary files")
+  flag.BoolVar(&f.allowBinary, "binary", false, "Alias for -a")
   flag.BoolVar(&f.icase, "i", false, "Performs case insensitive matching")
   flag.BoolVar(&f.nocolor, "raw", false, "Disable colored output")
-  flag.StringVar(&f.exclude, "exc", "", "Excluded paths (specified as a comma separated list like \"path1,path2\")")
+  flag.StringVar(&f.exclude, "exc", "", "Excluded paths, gitignore-style glob patterns (comma separated list like \"path1,**/path2\")")
+  flag.StringVar(&f.excludeFiles, "exc-file", "", "Gitignore-format files to read exclusion patterns from (comma separated list)")
+  flag.BoolVar(&f.useGitignore, "git", false, "Honor .gitignore files found walking up from the starting path")
   flag.BoolVar(&f.matchContext, "ctx", false, "Print every match for a file")
-
-  f.limitBytes = f.limitBytes * MEGABYTE
+  flag.BoolVar(&f.archives, "archives", false, "Descend into .zip, .tar, .tar.gz and .jar archives as if they were directories")
+  flag.IntVar(&f.afterLines, "A", 0, "With -ctx, print N lines of trailing context after each match")
+  flag.IntVar(&f.beforeLines, "B", 0, "With -ctx, print N lines of leading context before each match")
+  flag.IntVar(&f.ctxLines, "C", 0, "With -ctx, print N lines of context around each match (shorthand for -A N -B N)")
+  flag.StringVar(&f.format, "format", "text", "Output format: text, json or ndjson")
 
   flag.Parse()
 
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// A single compiled gitignore-style rule.
+type ignoreRule struct {
+	pattern  string // pattern relative to root, doublestar syntax
+	negate   bool   // leading "!"
+	dirOnly  bool   // trailing "/"
+	anchored bool   // leading "/" (or contains a "/" before the last segment)
+	root     string // directory the rule is relative to
+}
+
+// PathSpec holds an ordered set of gitignore-style rules and decides
+// whether a given path is excluded from the search. Later rules take
+// precedence over earlier ones, mirroring git's own semantics.
+type PathSpec struct {
+	rules []ignoreRule
+}
+
+// NewPathSpec builds a PathSpec out of inline patterns (as passed via -exc)
+// and the contents of one or more gitignore-format files (as passed via
+// -exc-file). root is the directory the inline patterns are anchored to.
+func NewPathSpec(root string, inline []string, files []string) (*PathSpec, error) {
+	ps := &PathSpec{}
+
+	for _, p := range inline {
+		if p == "" {
+			continue
+		}
+		ps.rules = append(ps.rules, parseIgnoreLine(root, p))
+	}
+
+	for _, f := range files {
+		if err := ps.addFile(f); err != nil {
+			return nil, err
+		}
+	}
+
+	return ps, nil
+}
+
+// addFile parses a single gitignore-format file, anchoring its patterns to
+// the file's own directory as git does.
+func (ps *PathSpec) addFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	root := filepath.Dir(path)
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ps.rules = append(ps.rules, parseIgnoreLine(root, line))
+	}
+
+	return scanner.Err()
+}
+
+// collectGitignores walks up from startpath to the filesystem root and
+// builds a rule set out of every .gitignore file found along the way, so
+// that -git picks up the same ignores a checkout of the repo would honor.
+// Rules are appended root-first so that, under Match's last-match-wins
+// semantics, a nearer and more specific .gitignore takes precedence over
+// one higher up the tree, mirroring git's own behavior.
+func collectGitignores(startpath string) (*PathSpec, error) {
+	ps := &PathSpec{}
+
+	abs, err := filepath.Abs(startpath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := abs
+	if fi, err := os.Stat(abs); err == nil && !fi.IsDir() {
+		dir = filepath.Dir(abs)
+	}
+
+	var dirs []string
+	for {
+		dirs = append(dirs, dir)
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		candidate := filepath.Join(dirs[i], ".gitignore")
+		if _, err := os.Stat(candidate); err == nil {
+			if err := ps.addFile(candidate); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ps, nil
+}
+
+// parseIgnoreLine turns a single gitignore line into a compiled rule.
+func parseIgnoreLine(root, line string) ignoreRule {
+	rule := ignoreRule{root: root}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	if strings.HasPrefix(line, "/") {
+		rule.anchored = true
+		line = line[1:]
+	} else if strings.Contains(line, "/") {
+		rule.anchored = true
+	}
+
+	// Only unanchored patterns get a "**/" prefix to match at any depth; an
+	// anchored single-segment pattern like "/build.log" must still only
+	// match at root, not have its anchoring undone here.
+	if !rule.anchored {
+		line = "**/" + line
+	}
+
+	rule.pattern = line
+	return rule
+}
+
+// Match reports whether pathname (a file or directory) is excluded by the
+// spec. The last matching rule wins, so a later "!" pattern can re-include
+// something an earlier broader pattern excluded.
+func (ps *PathSpec) Match(pathname string, isDir bool) bool {
+	excluded := false
+	absPath := ""
+
+	for _, rule := range ps.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		rel, err := filepath.Rel(rule.root, pathname)
+		if err != nil {
+			// One side is absolute and the other relative (e.g. -git roots
+			// against a relative startpath): compare them as absolute paths.
+			if absPath == "" {
+				absPath, _ = filepath.Abs(pathname)
+			}
+			absRoot, _ := filepath.Abs(rule.root)
+			rel, err = filepath.Rel(absRoot, absPath)
+		}
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+
+		ok, _ := doublestar.Match(rule.pattern, rel)
+		if !ok && !rule.anchored {
+			ok, _ = doublestar.Match(rule.pattern, filepath.ToSlash(filepath.Base(pathname)))
+		}
+
+		if ok {
+			excluded = !rule.negate
+		}
+	}
+
+	return excluded
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIgnoreLine(t *testing.T) {
+	cases := []struct {
+		name     string
+		line     string
+		negate   bool
+		dirOnly  bool
+		anchored bool
+		pattern  string
+	}{
+		{
+			name:    "plain basename pattern is unanchored",
+			line:    "*.log",
+			pattern: "**/*.log",
+		},
+		{
+			name:     "leading slash anchors to root",
+			line:     "/build.log",
+			anchored: true,
+			pattern:  "build.log",
+		},
+		{
+			name:     "an internal slash anchors even without a leading one",
+			line:     "sub/*.go",
+			anchored: true,
+			pattern:  "sub/*.go",
+		},
+		{
+			name:    "trailing slash marks dir-only",
+			line:    "build/",
+			dirOnly: true,
+			pattern: "**/build",
+		},
+		{
+			name:    "leading ! negates",
+			line:    "!keep.go",
+			negate:  true,
+			pattern: "**/keep.go",
+		},
+		{
+			name:     "negation composes with anchoring and dir-only",
+			line:     "!/sub/build/",
+			negate:   true,
+			dirOnly:  true,
+			anchored: true,
+			pattern:  "sub/build",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rule := parseIgnoreLine("/root", c.line)
+			if rule.negate != c.negate {
+				t.Errorf("negate = %v, want %v", rule.negate, c.negate)
+			}
+			if rule.dirOnly != c.dirOnly {
+				t.Errorf("dirOnly = %v, want %v", rule.dirOnly, c.dirOnly)
+			}
+			if rule.anchored != c.anchored {
+				t.Errorf("anchored = %v, want %v", rule.anchored, c.anchored)
+			}
+			if rule.pattern != c.pattern {
+				t.Errorf("pattern = %q, want %q", rule.pattern, c.pattern)
+			}
+		})
+	}
+}
+
+func TestPathSpecMatchUnanchoredMatchesAnyDepth(t *testing.T) {
+	root := t.TempDir()
+	ps, err := NewPathSpec(root, []string{"*.log"}, nil)
+	if err != nil {
+		t.Fatalf("NewPathSpec: %v", err)
+	}
+
+	if !ps.Match(filepath.Join(root, "debug.log"), false) {
+		t.Error("expected debug.log to be excluded")
+	}
+	if !ps.Match(filepath.Join(root, "nested", "deep", "debug.log"), false) {
+		t.Error("expected nested/deep/debug.log to be excluded by an unanchored pattern")
+	}
+	if ps.Match(filepath.Join(root, "keep.txt"), false) {
+		t.Error("keep.txt should not be excluded")
+	}
+}
+
+func TestPathSpecMatchAnchoredOnlyMatchesFromRoot(t *testing.T) {
+	root := t.TempDir()
+	ps, err := NewPathSpec(root, []string{"/build.log"}, nil)
+	if err != nil {
+		t.Fatalf("NewPathSpec: %v", err)
+	}
+
+	if !ps.Match(filepath.Join(root, "build.log"), false) {
+		t.Error("expected root-level build.log to be excluded")
+	}
+	if ps.Match(filepath.Join(root, "nested", "build.log"), false) {
+		t.Error("anchored pattern should not match build.log in a subdirectory")
+	}
+}
+
+func TestPathSpecMatchDirOnlySkipsFiles(t *testing.T) {
+	root := t.TempDir()
+	ps, err := NewPathSpec(root, []string{"build/"}, nil)
+	if err != nil {
+		t.Fatalf("NewPathSpec: %v", err)
+	}
+
+	if ps.Match(filepath.Join(root, "build"), false) {
+		t.Error("dir-only pattern should not exclude a regular file named build")
+	}
+	if !ps.Match(filepath.Join(root, "build"), true) {
+		t.Error("dir-only pattern should exclude a directory named build")
+	}
+}
+
+func TestPathSpecMatchNegationReincludes(t *testing.T) {
+	root := t.TempDir()
+	ps, err := NewPathSpec(root, []string{"*.go", "!keep.go"}, nil)
+	if err != nil {
+		t.Fatalf("NewPathSpec: %v", err)
+	}
+
+	if ps.Match(filepath.Join(root, "keep.go"), false) {
+		t.Error("a later '!' rule should re-include keep.go")
+	}
+	if !ps.Match(filepath.Join(root, "other.go"), false) {
+		t.Error("other.go should still be excluded")
+	}
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll(%q): %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("WriteFile(%q): %v", path, err)
+	}
+}
+
+// TestCollectGitignoresNestedWinsOverRoot is a regression test for the
+// precedence bug fixed alongside this test: a nested .gitignore re-including
+// a file must win over a broader exclude higher up the tree, the same way
+// git itself resolves the conflict.
+func TestCollectGitignoresNestedWinsOverRoot(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "sub/*.go\n")
+	writeFile(t, filepath.Join(root, "sub", ".gitignore"), "!keep.go\n")
+
+	ps, err := collectGitignores(filepath.Join(root, "sub"))
+	if err != nil {
+		t.Fatalf("collectGitignores: %v", err)
+	}
+
+	if ps.Match(filepath.Join(root, "sub", "keep.go"), false) {
+		t.Error("nested .gitignore's '!keep.go' should re-include sub/keep.go over the root's broader exclude")
+	}
+	if !ps.Match(filepath.Join(root, "sub", "other.go"), false) {
+		t.Error("sub/other.go should still be excluded by the root .gitignore")
+	}
+}
+
+// TestBuildPathSpecExcludeOverridesGitignore mirrors the precedence
+// Flags.BuildPathSpec assembles (git rules first, user -exc/-exc-file rules
+// appended after) to pin the fix that made explicit command-line excludes
+// win over whatever a project's own .gitignore happens to say.
+func TestBuildPathSpecExcludeOverridesGitignore(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "!important.log\n")
+
+	git, err := collectGitignores(root)
+	if err != nil {
+		t.Fatalf("collectGitignores: %v", err)
+	}
+
+	user, err := NewPathSpec(root, []string{"*.log"}, nil)
+	if err != nil {
+		t.Fatalf("NewPathSpec: %v", err)
+	}
+
+	ps := &PathSpec{}
+	ps.rules = append(ps.rules, git.rules...)
+	ps.rules = append(ps.rules, user.rules...)
+
+	if !ps.Match(filepath.Join(root, "important.log"), false) {
+		t.Error("user-supplied -exc pattern should win over the repo's own .gitignore re-include")
+	}
+}
@@ -0,0 +1,140 @@
+// Package pipe implements a small backpressure-aware producer/consumer
+// pipeline for walking a filesystem and fanning the work it finds out to a
+// pool of worker goroutines.
+//
+// A single producer walks an fs.FS, turning every path SelectFunc accepts
+// into a Job and handing it to whichever Consumer is free next. Because the
+// Jobs channel is unbuffered, the producer naturally blocks whenever every
+// consumer is busy instead of piling work up in memory, and the whole walk
+// can be torn down early through Done.
+package pipe
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+)
+
+// Job describes a single selected path and carries the channel its result
+// should be reported back on.
+type Job struct {
+	Path  string
+	Info  fs.FileInfo
+	FS    fs.FS
+	Reply chan<- Result
+}
+
+// Result is what a JobFunc reports back for a Job it processed.
+type Result struct {
+	Path string
+	Err  error
+}
+
+// SelectFunc decides whether a visited path should become a Job, returning
+// the fs.FileInfo to carry on the Job when it does (Walk threads it through
+// as-is rather than re-stat'ing the path itself, which would reopen a TOCTOU
+// window on filesystems where DirEntry.Info() isn't cached). It mirrors
+// fs.WalkDirFunc: returning fs.SkipDir prunes the directory currently being
+// visited, and any other non-nil error aborts the walk.
+type SelectFunc func(path string, d fs.DirEntry, err error) (bool, fs.FileInfo, error)
+
+// JobFunc performs the actual work for a Job (e.g. the regex scan) and
+// returns the Result to report back.
+type JobFunc func(job Job) Result
+
+// Consumer repeatedly pulls Jobs off a shared channel, runs Fn on each and
+// replies on the Job's own Reply channel, until Jobs is closed or Done
+// fires.
+type Consumer struct {
+	Jobs <-chan Job
+	Done <-chan struct{}
+	Fn   JobFunc
+}
+
+// Run is the Consumer's goroutine body; callers typically do
+// `go consumer.Run(wg)` for each worker in the pool.
+func (c *Consumer) Run(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case <-c.Done:
+			return
+		case job, more := <-c.Jobs:
+			if !more {
+				return
+			}
+			job.Reply <- c.Fn(job)
+		}
+	}
+}
+
+// Walk walks fsys from its root, consulting selectFn for every entry and
+// dispatching a Job to the next free Consumer for every path it accepts.
+// Results stream out on the returned channel as consumers finish them,
+// which is closed once the walk and every in-flight Job have completed.
+// The walk stops early, without error, as soon as ctx is done.
+func Walk(ctx context.Context, fsys fs.FS, workers int, selectFn SelectFunc, jobFn JobFunc) <-chan Result {
+	done := ctx.Done()
+	jobs := make(chan Job)
+	out := make(chan Result)
+
+	var consumers sync.WaitGroup
+	consumers.Add(workers)
+	for i := 0; i < workers; i++ {
+		c := &Consumer{Jobs: jobs, Done: done, Fn: jobFn}
+		go c.Run(&consumers)
+	}
+
+	var pending sync.WaitGroup
+
+	go func() {
+		defer close(jobs)
+
+		_ = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+			select {
+			case <-done:
+				return ctx.Err()
+			default:
+			}
+
+			ok, info, serr := selectFn(path, d, err)
+			if serr != nil || !ok {
+				return serr
+			}
+
+			reply := make(chan Result, 1)
+			job := Job{Path: path, Info: info, FS: fsys, Reply: reply}
+
+			pending.Add(1)
+			select {
+			case jobs <- job:
+			case <-done:
+				pending.Done()
+				return ctx.Err()
+			}
+
+			go func() {
+				defer pending.Done()
+				select {
+				case res := <-reply:
+					select {
+					case out <- res:
+					case <-done:
+					}
+				case <-done:
+				}
+			}()
+
+			return nil
+		})
+	}()
+
+	go func() {
+		consumers.Wait()
+		pending.Wait()
+		close(out)
+	}()
+
+	return out
+}
@@ -0,0 +1,114 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func mapFSWithFiles(n int) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for i := 0; i < n; i++ {
+		fsys[fmt.Sprintf("file%02d.txt", i)] = &fstest.MapFile{Data: []byte("x")}
+	}
+	return fsys
+}
+
+func selectRegular(path string, d fs.DirEntry, err error) (bool, fs.FileInfo, error) {
+	if err != nil {
+		return false, nil, err
+	}
+	if d.IsDir() {
+		return false, nil, nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false, nil, err
+	}
+	return true, info, nil
+}
+
+// TestWalkRespectsWorkerBackpressure proves the unbuffered Jobs channel
+// never lets more than `workers` jobs run at once, by blocking every job on
+// a shared gate and tracking the high-water mark of concurrent jobFn calls.
+func TestWalkRespectsWorkerBackpressure(t *testing.T) {
+	const total = 20
+	const workers = 3
+
+	fsys := mapFSWithFiles(total)
+
+	var inFlight, maxInFlight int64
+	release := make(chan struct{})
+
+	jobFn := func(job Job) Result {
+		cur := atomic.AddInt64(&inFlight, 1)
+		for {
+			old := atomic.LoadInt64(&maxInFlight)
+			if cur <= old || atomic.CompareAndSwapInt64(&maxInFlight, old, cur) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt64(&inFlight, -1)
+		return Result{Path: job.Path}
+	}
+
+	out := Walk(context.Background(), fsys, workers, selectRegular, jobFn)
+
+	// Give the worker pool time to saturate at its cap before releasing the
+	// jobs, otherwise we might observe fewer in-flight jobs than the walk
+	// would actually allow.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	count := 0
+	for range out {
+		count++
+	}
+
+	if count != total {
+		t.Fatalf("got %d results, want %d", count, total)
+	}
+	if got := atomic.LoadInt64(&maxInFlight); got > workers {
+		t.Fatalf("max concurrent jobs = %d, want <= %d (workers)", got, workers)
+	}
+}
+
+// TestWalkStopsOnCancellation proves Walk tears down promptly, without
+// draining the rest of the tree, once its context is cancelled.
+func TestWalkStopsOnCancellation(t *testing.T) {
+	fsys := mapFSWithFiles(200)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var started int64
+	jobFn := func(job Job) Result {
+		atomic.AddInt64(&started, 1)
+		time.Sleep(5 * time.Millisecond)
+		return Result{Path: job.Path}
+	}
+
+	out := Walk(ctx, fsys, 2, selectRegular, jobFn)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for range out {
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Walk did not stop after its context was cancelled")
+	}
+
+	if got := atomic.LoadInt64(&started); got >= 200 {
+		t.Fatalf("started %d of 200 jobs after an immediate cancellation, want far fewer", got)
+	}
+}
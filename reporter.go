@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// Match is a single match reported by the search core: a whole-file match
+// (Line == 0) when not in -ctx mode, or one matching line plus its
+// surrounding context when it is.
+type Match struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line,omitempty"`
+	Column int      `json:"column,omitempty"`
+	Match  string   `json:"match,omitempty"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// Summary is reported once, after the whole search has finished.
+type Summary struct {
+	FilesScanned int64 `json:"files_scanned"`
+	FilesMatched int64 `json:"files_matched"`
+	BytesScanned int64 `json:"bytes_scanned"`
+	ElapsedMs    int64 `json:"elapsed_ms"`
+	Errors       int64 `json:"errors"`
+}
+
+var highlight = color.New(color.FgHiYellow, color.Underline).SprintFunc()
+
+// Reporter decouples the search core from how its results are presented,
+// so the same pipeline can drive a human-readable terminal report or a
+// machine consumable one.
+type Reporter interface {
+	ReportMatch(m Match)
+	ReportMatches(matches []Match)
+	ReportError(path string, err error)
+	ReportSummary(s Summary)
+}
+
+// TextReporter reproduces mgp's original colored, human-readable output.
+type TextReporter struct {
+	out     io.Writer
+	pattern *regexp.Regexp
+	colors  bool
+	mu      sync.Mutex
+}
+
+func NewTextReporter(out io.Writer, pattern *regexp.Regexp, colors bool) *TextReporter {
+	return &TextReporter{out: out, pattern: pattern, colors: colors}
+}
+
+func (t *TextReporter) write(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.out.Write(p)
+}
+
+func (t *TextReporter) ReportMatch(m Match) {
+	if m.Line == 0 {
+		if t.colors {
+			t.write([]byte(fmt.Sprintf("%v %v\n", green(OK), m.Path)))
+		} else {
+			t.write([]byte(fmt.Sprintf("%v\n", m.Path)))
+		}
+		return
+	}
+
+	t.ReportMatches([]Match{m})
+}
+
+// ReportMatches renders every -ctx Match found in a single file as one
+// buffer flushed with a single write, so concurrent workers can never
+// interleave contexts from different files. A "--" separator is inserted
+// between blocks that aren't contiguous, the same way grep's own context
+// output does.
+func (t *TextReporter) ReportMatches(matches []Match) {
+	if len(matches) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	lastPrinted := 0 // 1-based number of the last line written, 0 = none yet
+
+	write := func(path string, n int, line string, isMatch bool) {
+		if lastPrinted != 0 && n > lastPrinted+1 {
+			buf.WriteString("--\n")
+		}
+		sep := "-"
+		text := line
+		if isMatch {
+			sep = ":"
+			if t.colors {
+				text = t.highlight(line)
+			}
+		}
+		fmt.Fprintf(&buf, "%v:%v%v %v\n", path, n, sep, text)
+		lastPrinted = n
+	}
+
+	for _, m := range matches {
+		n := m.Line - len(m.Before)
+		for _, l := range m.Before {
+			if n > lastPrinted {
+				write(m.Path, n, l, false)
+			}
+			n++
+		}
+
+		write(m.Path, m.Line, m.Match, true)
+
+		n = m.Line + 1
+		for _, l := range m.After {
+			write(m.Path, n, l, false)
+			n++
+		}
+	}
+
+	t.write(buf.Bytes())
+}
+
+// highlight wraps every match of the reporter's pattern in line with the
+// highlight color.
+func (t *TextReporter) highlight(line string) string {
+	return t.pattern.ReplaceAllStringFunc(line, func(m string) string {
+		return highlight(m)
+	})
+}
+
+func (t *TextReporter) ReportError(path string, err error) {
+	var buf bytes.Buffer
+	if t.colors {
+		fmt.Fprintf(&buf, "%v %v\n", red(KO), path)
+	}
+	fmt.Fprintln(&buf, err)
+	t.write(buf.Bytes())
+}
+
+func (t *TextReporter) ReportSummary(s Summary) {}
+
+// JSONReporter emits either a single {matches, summary} document (json) or
+// one object per line as soon as it's produced (ndjson).
+type JSONReporter struct {
+	out     io.Writer
+	ndjson  bool
+	mu      sync.Mutex
+	matches []Match
+}
+
+func NewJSONReporter(out io.Writer) *JSONReporter   { return &JSONReporter{out: out} }
+func NewNDJSONReporter(out io.Writer) *JSONReporter { return &JSONReporter{out: out, ndjson: true} }
+
+func (j *JSONReporter) ReportMatch(m Match) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.ndjson {
+		json.NewEncoder(j.out).Encode(m)
+		return
+	}
+
+	j.matches = append(j.matches, m)
+}
+
+// ReportMatches reports every Match of a file individually: unlike
+// TextReporter's line-oriented output, each JSON/NDJSON match is already a
+// self-contained value, so there's nothing for concurrent files to
+// interleave within.
+func (j *JSONReporter) ReportMatches(matches []Match) {
+	for _, m := range matches {
+		j.ReportMatch(m)
+	}
+}
+
+func (j *JSONReporter) ReportError(path string, err error) {
+	if !j.ndjson {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	json.NewEncoder(j.out).Encode(struct {
+		Path  string `json:"path"`
+		Error string `json:"error"`
+	}{path, err.Error()})
+}
+
+func (j *JSONReporter) ReportSummary(s Summary) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.ndjson {
+		json.NewEncoder(j.out).Encode(s)
+		return
+	}
+
+	enc := json.NewEncoder(j.out)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		Matches []Match `json:"matches"`
+		Summary Summary `json:"summary"`
+	}{j.matches, s})
+}
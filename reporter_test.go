@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONReporterWholeFileMatchOmitsContextFields(t *testing.T) {
+	var out bytes.Buffer
+	r := NewJSONReporter(&out)
+
+	r.ReportMatch(Match{Path: "foo.go"})
+	r.ReportSummary(Summary{FilesScanned: 1, FilesMatched: 1})
+
+	var doc struct {
+		Matches []map[string]any `json:"matches"`
+		Summary Summary          `json:"summary"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("Unmarshal: %v\noutput: %s", err, out.String())
+	}
+
+	if len(doc.Matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(doc.Matches))
+	}
+
+	m := doc.Matches[0]
+	if m["path"] != "foo.go" {
+		t.Errorf("path = %v, want foo.go", m["path"])
+	}
+	for _, field := range []string{"line", "column", "match", "before", "after"} {
+		if _, ok := m[field]; ok {
+			t.Errorf("whole-file match (Line == 0) should omit %q, got %v", field, m[field])
+		}
+	}
+
+	if doc.Summary.FilesScanned != 1 || doc.Summary.FilesMatched != 1 {
+		t.Errorf("summary = %+v, want FilesScanned=1 FilesMatched=1", doc.Summary)
+	}
+}
+
+func TestJSONReporterCtxMatchIncludesLineAndColumn(t *testing.T) {
+	var out bytes.Buffer
+	r := NewJSONReporter(&out)
+
+	r.ReportMatches([]Match{
+		{Path: "a.go", Line: 3, Column: 5, Match: "foo", Before: []string{"x"}, After: []string{"y"}},
+	})
+	r.ReportSummary(Summary{})
+
+	var doc struct {
+		Matches []Match `json:"matches"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("Unmarshal: %v\noutput: %s", err, out.String())
+	}
+	if len(doc.Matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(doc.Matches))
+	}
+
+	got := doc.Matches[0]
+	if got.Path != "a.go" || got.Line != 3 || got.Column != 5 || got.Match != "foo" {
+		t.Errorf("match = %+v, want Path=a.go Line=3 Column=5 Match=foo", got)
+	}
+	if len(got.Before) != 1 || got.Before[0] != "x" || len(got.After) != 1 || got.After[0] != "y" {
+		t.Errorf("match context = %+v, want Before=[x] After=[y]", got)
+	}
+}
+
+// TestJSONReporterErrorIsNoopInEnvelopeMode pins the -format json
+// contract: unlike ndjson, the single-document json envelope has no place to
+// put an error encountered mid-scan, so ReportError must stay a no-op there
+// rather than interleaving a foreign line into the JSON document.
+func TestJSONReporterErrorIsNoopInEnvelopeMode(t *testing.T) {
+	var out bytes.Buffer
+	r := NewJSONReporter(&out)
+
+	r.ReportError("broken.go", errPermissionDenied)
+	if out.Len() != 0 {
+		t.Fatalf("ReportError wrote %q in json mode, want nothing", out.String())
+	}
+
+	r.ReportSummary(Summary{Errors: 1})
+
+	var doc map[string]any
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("Unmarshal: %v\noutput: %s", err, out.String())
+	}
+	if _, ok := doc["error"]; ok {
+		t.Errorf("json envelope should not carry a per-error entry, got %v", doc)
+	}
+}
+
+func TestNDJSONReporterEmitsOneObjectPerLine(t *testing.T) {
+	var out bytes.Buffer
+	r := NewNDJSONReporter(&out)
+
+	r.ReportMatch(Match{Path: "a.go"})
+	r.ReportMatch(Match{Path: "b.go"})
+	r.ReportError("c.go", errPermissionDenied)
+	r.ReportSummary(Summary{FilesScanned: 2, Errors: 1})
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4 (two matches, one error, one summary)\noutput: %s", len(lines), out.String())
+	}
+
+	var m1, m2 Match
+	if err := json.Unmarshal([]byte(lines[0]), &m1); err != nil {
+		t.Fatalf("line 0: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &m2); err != nil {
+		t.Fatalf("line 1: %v", err)
+	}
+	if m1.Path != "a.go" || m2.Path != "b.go" {
+		t.Errorf("got paths %q, %q, want a.go, b.go", m1.Path, m2.Path)
+	}
+
+	var errLine struct {
+		Path  string `json:"path"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &errLine); err != nil {
+		t.Fatalf("line 2: %v", err)
+	}
+	if errLine.Path != "c.go" || errLine.Error == "" {
+		t.Errorf("error line = %+v, want path=c.go and a non-empty error", errLine)
+	}
+
+	var summary Summary
+	if err := json.Unmarshal([]byte(lines[3]), &summary); err != nil {
+		t.Fatalf("line 3: %v", err)
+	}
+	if summary.FilesScanned != 2 || summary.Errors != 1 {
+		t.Errorf("summary = %+v, want FilesScanned=2 Errors=1", summary)
+	}
+}
+
+type stubError string
+
+func (e stubError) Error() string { return string(e) }
+
+const errPermissionDenied = stubError("permission denied")